@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config holds every runtime setting that used to live in hardcoded
+// constants. Values are seeded with the defaults below, then optionally
+// overridden by a config file, then optionally overridden by CLI flags.
+type Config struct {
+	// PlaybackDirectory is a full or relative path to a directory containing
+	// music to be streamed to an Icecast server
+	// Note the ending separator
+	PlaybackDirectory string
+	// Loop between files / start over when all files were already streamed
+	Loop bool
+	// Shuffle files before streaming
+	Shuffle bool
+	// IcecastAddress represents an IP address of the Icecast2 server
+	IcecastAddress string
+	// IcecastPort represents a port Icecast2 server listens on
+	IcecastPort int
+	// IcecastUser represents a username of a source to stream with
+	IcecastUser string
+	// IcecastPassword represents a password for the above user
+	IcecastPassword string
+	// IcecastMount is the mount point the stream is published under
+	IcecastMount string
+	// Bitrate is the encoding bitrate passed to ffmpeg, in kbps
+	Bitrate int
+	// Format is the output codec/container, e.g. "mp3"
+	Format string
+	// ChunkSize is the size, in bytes, of the PCM chunks the mixer reads
+	// and writes at a time while streaming and crossfading tracks
+	ChunkSize int
+	// EncoderName selects the Encoder implementation: "ffmpeg", "lame" or "opus"
+	EncoderName string
+	// ContentType is the MIME type advertised to Icecast for the stream,
+	// always derived from the selected encoder
+	ContentType string
+	// IcecastProtocol selects the source handshake: "put" (HTTP/1.1 PUT,
+	// the modern Icecast2 protocol) or "source" (legacy Shoutcast/Icecast
+	// "SOURCE /mount ICE/1.0" handshake)
+	IcecastProtocol string
+	// IceName is announced to listeners as the stream's name
+	IceName string
+	// IceDescription is announced to listeners as the stream's description
+	IceDescription string
+	// IceURL is announced to listeners as the stream's homepage
+	IceURL string
+	// IceGenre is announced to listeners as the stream's genre
+	IceGenre string
+	// ControlPort is the port the HTTP control API listens on. A value of
+	// 0 disables the control API.
+	ControlPort int
+	// ControlToken is the shared secret clients must present (as a
+	// "Authorization: Bearer <token>" header) to use the control API. If
+	// left empty, main generates a random one at startup and prints it,
+	// rather than ever serving the API without authentication.
+	ControlToken string
+	// Extensions lists the file extensions (including the leading dot,
+	// lowercase) that the library scanner treats as audio
+	Extensions []string
+	// CrossfadeSeconds is how long the tail of one track overlaps with
+	// the head of the next during playback
+	CrossfadeSeconds int
+
+	// mountExplicit is true once the user sets a mount point explicitly,
+	// via either the config file or the -mount flag, so an encoder
+	// selection doesn't clobber a mount point they asked for explicitly
+	mountExplicit bool
+}
+
+// DefaultConfig returns the settings Yakima used to ship as compile-time
+// constants. It is the starting point before a config file or flags are
+// applied.
+func DefaultConfig() *Config {
+	return &Config{
+		PlaybackDirectory: "/home/alis/Music/",
+		Loop:              true,
+		Shuffle:           false,
+		IcecastAddress:    "127.0.0.1",
+		IcecastPort:       8999,
+		IcecastUser:       "source",
+		IcecastPassword:   "1234",
+		IcecastMount:      "/stream.mp3",
+		Bitrate:           128,
+		Format:            "mp3",
+		ChunkSize:         1024,
+		EncoderName:       "ffmpeg",
+		ContentType:       "audio/mpeg",
+		IcecastProtocol:   "put",
+		IceName:           "Yakima",
+		IceDescription:    "",
+		IceURL:            "",
+		IceGenre:          "Yakima",
+		ControlPort:       8001,
+		Extensions:        []string{".mp3", ".flac", ".ogg", ".opus", ".m4a", ".wav"},
+		CrossfadeSeconds:  5,
+	}
+}
+
+// LoadConfigFile reads a simple "key = value" INI-style file and applies
+// any recognized keys on top of cfg. Lines starting with "#" or ";" and
+// blank lines are ignored. Unknown keys are ignored so the file can carry
+// comments or settings for future versions without breaking older builds.
+func LoadConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "dir", "directory":
+			cfg.PlaybackDirectory = value
+		case "loop":
+			cfg.Loop = parseBool(value, cfg.Loop)
+		case "shuffle":
+			cfg.Shuffle = parseBool(value, cfg.Shuffle)
+		case "host", "address":
+			cfg.IcecastAddress = value
+		case "port":
+			if port, err := strconv.Atoi(value); err == nil {
+				cfg.IcecastPort = port
+			}
+		case "user":
+			cfg.IcecastUser = value
+		case "password":
+			cfg.IcecastPassword = value
+		case "mount":
+			cfg.IcecastMount = value
+			cfg.mountExplicit = true
+		case "bitrate":
+			if bitrate, err := strconv.Atoi(value); err == nil {
+				cfg.Bitrate = bitrate
+			}
+		case "format":
+			cfg.Format = value
+		case "chunk":
+			if size, err := strconv.Atoi(value); err == nil {
+				cfg.ChunkSize = size
+			}
+		case "encoder":
+			cfg.EncoderName = value
+		case "protocol":
+			cfg.IcecastProtocol = value
+		case "ice-name":
+			cfg.IceName = value
+		case "ice-description":
+			cfg.IceDescription = value
+		case "ice-url":
+			cfg.IceURL = value
+		case "ice-genre":
+			cfg.IceGenre = value
+		case "control-port":
+			if port, err := strconv.Atoi(value); err == nil {
+				cfg.ControlPort = port
+			}
+		case "control-token":
+			cfg.ControlToken = value
+		case "extensions":
+			cfg.Extensions = parseExtensions(value)
+		case "crossfade":
+			if seconds, err := strconv.Atoi(value); err == nil {
+				cfg.CrossfadeSeconds = seconds
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseBool interprets common truthy/falsy strings, falling back to
+// fallback if the value isn't recognized.
+func parseBool(value string, fallback bool) bool {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// parseExtensions splits a comma-separated list of file extensions,
+// lowercasing each and making sure it starts with a dot.
+func parseExtensions(value string) []string {
+	var extensions []string
+	for _, raw := range strings.Split(value, ",") {
+		ext := strings.ToLower(strings.TrimSpace(raw))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+// ParseFlags registers CLI flags for every setting in cfg and parses
+// os.Args, overriding cfg in place. A flag only takes effect if it was
+// actually passed, so config file values survive when a flag is omitted.
+// The "-config" flag, if given, is read and applied before flags are
+// resolved, so CLI flags always win over the config file.
+func ParseFlags(cfg *Config) {
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "path to an INI-style config file")
+
+	// A first pass just to pick up -config before registering the rest,
+	// so LoadConfigFile runs before flag defaults are baked in below.
+	preArgs := os.Args[1:]
+	for i, arg := range preArgs {
+		if arg == "-config" || arg == "--config" {
+			if i+1 < len(preArgs) {
+				configPath = preArgs[i+1]
+			}
+		} else if strings.HasPrefix(arg, "-config=") {
+			configPath = strings.TrimPrefix(arg, "-config=")
+		} else if strings.HasPrefix(arg, "--config=") {
+			configPath = strings.TrimPrefix(arg, "--config=")
+		}
+	}
+
+	if configPath != "" {
+		if err := LoadConfigFile(configPath, cfg); err != nil {
+			fmt.Println("Could not read config file \"" + configPath + "\": " + err.Error())
+			os.Exit(1)
+		}
+	}
+
+	dir := flag.String("dir", cfg.PlaybackDirectory, "directory to stream music from")
+	loop := flag.Bool("loop", cfg.Loop, "loop the playlist when it ends")
+	shuffle := flag.Bool("shuffle", cfg.Shuffle, "shuffle files before streaming")
+	host := flag.String("host", cfg.IcecastAddress, "Icecast server address")
+	port := flag.Int("port", cfg.IcecastPort, "Icecast server port")
+	user := flag.String("user", cfg.IcecastUser, "Icecast source username")
+	password := flag.String("password", cfg.IcecastPassword, "Icecast source password")
+	mount := flag.String("mount", cfg.IcecastMount, "Icecast mount point")
+	bitrate := flag.Int("bitrate", cfg.Bitrate, "encoding bitrate in kbps")
+	format := flag.String("format", cfg.Format, "output format, e.g. mp3")
+	chunk := flag.Int("chunk", cfg.ChunkSize, "PCM mixing chunk size in bytes")
+	encoder := flag.String("encoder", cfg.EncoderName, "encoder backend: ffmpeg, lame or opus")
+	protocol := flag.String("protocol", cfg.IcecastProtocol, "Icecast handshake: put or source")
+	iceName := flag.String("ice-name", cfg.IceName, "stream name announced to listeners")
+	iceDescription := flag.String("ice-description", cfg.IceDescription, "stream description announced to listeners")
+	iceURL := flag.String("ice-url", cfg.IceURL, "stream homepage announced to listeners")
+	iceGenre := flag.String("ice-genre", cfg.IceGenre, "stream genre announced to listeners")
+	controlPort := flag.Int("control-port", cfg.ControlPort, "HTTP control API port, 0 to disable")
+	controlToken := flag.String("control-token", cfg.ControlToken, "shared secret required to use the control API; a random one is generated and printed if left empty")
+	extensions := flag.String("extensions", strings.Join(cfg.Extensions, ","), "comma-separated list of audio file extensions to scan for")
+	crossfade := flag.Int("crossfade", cfg.CrossfadeSeconds, "seconds of overlap between consecutive tracks")
+
+	flag.Parse()
+
+	cfg.PlaybackDirectory = *dir
+	cfg.Loop = *loop
+	cfg.Shuffle = *shuffle
+	cfg.IcecastAddress = *host
+	cfg.IcecastPort = *port
+	cfg.IcecastUser = *user
+	cfg.IcecastPassword = *password
+	cfg.IcecastMount = *mount
+	cfg.Bitrate = *bitrate
+	cfg.Format = *format
+	cfg.ChunkSize = *chunk
+	cfg.EncoderName = *encoder
+	cfg.IcecastProtocol = *protocol
+	cfg.IceName = *iceName
+	cfg.IceDescription = *iceDescription
+	cfg.IceURL = *iceURL
+	cfg.IceGenre = *iceGenre
+	cfg.ControlPort = *controlPort
+	cfg.ControlToken = *controlToken
+	cfg.Extensions = parseExtensions(*extensions)
+	cfg.CrossfadeSeconds = *crossfade
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "mount" {
+			cfg.mountExplicit = true
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseBool(t *testing.T) {
+	if !parseBool("true", false) {
+		t.Error(`parseBool("true", false) = false, want true`)
+	}
+	if parseBool("not-a-bool", true) != true {
+		t.Error(`parseBool("not-a-bool", true) should fall back to true`)
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	got := parseExtensions(" MP3, .flac ,ogg")
+	want := []string{".mp3", ".flac", ".ogg"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseExtensions(...) = %v, want %v", got, want)
+	}
+}
+
+func TestLoadConfigFileMarksMountExplicit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "yakima.conf")
+	if err := os.WriteFile(path, []byte("encoder = opus\nmount = /custom.opus\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	if err := LoadConfigFile(path, cfg); err != nil {
+		t.Fatalf("LoadConfigFile: %v", err)
+	}
+	if !cfg.mountExplicit {
+		t.Fatal("expected mountExplicit to be true after a config file sets mount")
+	}
+
+	encoder := NewEncoder(cfg)
+	ApplyEncoderDefaults(cfg, encoder)
+	if cfg.IcecastMount != "/custom.opus" {
+		t.Errorf("IcecastMount = %q, want /custom.opus (config file value should survive ApplyEncoderDefaults)", cfg.IcecastMount)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// generateControlToken returns a random hex token suitable as a control
+// API shared secret, for when the operator hasn't configured one of
+// their own.
+func generateControlToken() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// ControlServer exposes a Player's state and controls over a small JSON
+// HTTP API, so the stream can be inspected and steered without restarting
+// the process. Every request must carry the configured token, since the
+// API can enqueue files from the playback directory and steer playback.
+type ControlServer struct {
+	player *Player
+	token  string
+}
+
+// NewControlServer builds a ControlServer around player. token is the
+// shared secret required of every request; requests are rejected if it's
+// empty, so a ControlServer can't accidentally be run unauthenticated.
+func NewControlServer(player *Player, token string) *ControlServer {
+	return &ControlServer{player: player, token: token}
+}
+
+// ListenAndServe starts the control API on the given port. It blocks, so
+// callers typically run it in its own goroutine.
+func (c *ControlServer) ListenAndServe(port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/now", c.handleNow)
+	mux.HandleFunc("/queue", c.handleQueue)
+	mux.HandleFunc("/skip", c.handleSkip)
+	mux.HandleFunc("/enqueue", c.handleEnqueue)
+	mux.HandleFunc("/shuffle", c.handleShuffle)
+	return http.ListenAndServe(":"+strconv.Itoa(port), c.requireToken(mux))
+}
+
+// requireToken wraps next so every request must present the control
+// token as "Authorization: Bearer <token>", rejecting everything else.
+func (c *ControlServer) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.token == "" || r.Header.Get("Authorization") != "Bearer "+c.token {
+			http.Error(w, "missing or invalid control token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trackInfo is the JSON view of an AudioFile: AudioFile's fields are
+// unexported so they survive refactors without becoming API contracts,
+// this type is the deliberate exception.
+type trackInfo struct {
+	Filename        string      `json:"filename"`
+	Duration        int         `json:"duration"`
+	OriginalQuality qualityInfo `json:"originalQuality"`
+}
+
+type qualityInfo struct {
+	Bitrate     int    `json:"bitrate"`
+	SampleRate  int    `json:"sampleRate"`
+	ChannelMode string `json:"channelMode"`
+	Format      string `json:"format"`
+}
+
+func newTrackInfo(file AudioFile) trackInfo {
+	return trackInfo{
+		Filename: file.filename,
+		Duration: file.duration,
+		OriginalQuality: qualityInfo{
+			Bitrate:     file.originalQuality.bitrate,
+			SampleRate:  file.originalQuality.sampleRate,
+			ChannelMode: file.originalQuality.channelMode,
+			Format:      file.originalQuality.format,
+		},
+	}
+}
+
+type nowPlayingResponse struct {
+	trackInfo
+	Elapsed int `json:"elapsed"`
+}
+
+func (c *ControlServer) handleNow(w http.ResponseWriter, r *http.Request) {
+	file, elapsed, playing := c.player.NowPlaying()
+	if !playing {
+		http.Error(w, "nothing is playing", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, nowPlayingResponse{trackInfo: newTrackInfo(file), Elapsed: elapsed})
+}
+
+func (c *ControlServer) handleQueue(w http.ResponseWriter, r *http.Request) {
+	queue := c.player.Queue()
+	upcoming := make([]trackInfo, len(queue))
+	for i, file := range queue {
+		upcoming[i] = newTrackInfo(file)
+	}
+	writeJSON(w, upcoming)
+}
+
+func (c *ControlServer) handleSkip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	c.player.Skip()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type enqueueRequest struct {
+	Path string `json:"path"`
+}
+
+func (c *ControlServer) handleEnqueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req enqueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := c.player.Enqueue(req.Path); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *ControlServer) handleShuffle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	c.player.Shuffle()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("Could not write control API response: " + err.Error())
+	}
+}
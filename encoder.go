@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os/exec"
+	"strconv"
+
+	"github.com/sunicy/go-lame"
+	"layeh.com/gopus"
+)
+
+// StreamEncoder owns a single, long-lived encode session: it accepts a
+// continuous stream of raw PCM (at SampleRate/Channels) and writes the
+// encoded bitstream to an underlying io.Writer for as long as the
+// returned io.WriteCloser stays open. Unlike encoding file-by-file, this
+// keeps one continuous codec bitstream on the wire across track
+// boundaries, which is what makes gapless/crossfaded playback possible.
+type StreamEncoder interface {
+	// SampleRate is the PCM input rate this encoder expects.
+	SampleRate() int
+	// Channels is the PCM input channel count this encoder expects.
+	Channels() int
+	// OpenStream starts the encode session, writing encoded output to w.
+	// The returned io.WriteCloser accepts interleaved s16le PCM; closing
+	// it ends the session and lets w receive its final flushed frames.
+	OpenStream(w io.Writer) (io.WriteCloser, error)
+	// ContentType is the MIME type to advertise to Icecast for this stream.
+	ContentType() string
+	// MountPath is the default Icecast mount point for this stream.
+	MountPath() string
+}
+
+// NewEncoder builds the StreamEncoder selected by cfg.EncoderName,
+// defaulting to FFmpegEncoder for an empty or unrecognized name.
+func NewEncoder(cfg *Config) StreamEncoder {
+	switch cfg.EncoderName {
+	case "lame":
+		return &LameEncoder{Bitrate: cfg.Bitrate}
+	case "opus":
+		return &OpusEncoder{Bitrate: cfg.Bitrate}
+	default:
+		return &FFmpegEncoder{Bitrate: cfg.Bitrate, Format: cfg.Format}
+	}
+}
+
+// ApplyEncoderDefaults points cfg's mount and content type at enc's
+// defaults. The mount is left alone if the user already set one explicitly,
+// via the config file or the -mount flag; the content type is always set.
+func ApplyEncoderDefaults(cfg *Config, enc StreamEncoder) {
+	if !cfg.mountExplicit {
+		cfg.IcecastMount = enc.MountPath()
+	}
+	cfg.ContentType = enc.ContentType()
+}
+
+const (
+	pcmSampleRate = 44100
+	pcmChannels   = 2
+)
+
+// FFmpegEncoder shells out to a single long-lived ffmpeg process that
+// reads raw PCM on stdin and writes the compressed bitstream to w.
+type FFmpegEncoder struct {
+	Bitrate int
+	Format  string
+}
+
+// SampleRate reports the PCM input rate this encoder expects.
+func (e *FFmpegEncoder) SampleRate() int { return pcmSampleRate }
+
+// Channels reports the PCM input channel count this encoder expects.
+func (e *FFmpegEncoder) Channels() int { return pcmChannels }
+
+// OpenStream starts ffmpeg with w as its stdout and returns its stdin, so
+// callers can feed it a continuous stream of PCM.
+func (e *FFmpegEncoder) OpenStream(w io.Writer) (io.WriteCloser, error) {
+	cmd := exec.Command("ffmpeg",
+		"-f", "s16le", "-ar", strconv.Itoa(pcmSampleRate), "-ac", strconv.Itoa(pcmChannels), "-i", "-",
+		"-f", e.Format, "-c:a", e.Format, "-b:a", strconv.Itoa(e.Bitrate)+"k", "-")
+	cmd.Stdout = w
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			fmt.Println("ffmpeg encoder exited: " + err.Error())
+		}
+	}()
+
+	return stdin, nil
+}
+
+// ContentType reports audio/mpeg.
+func (e *FFmpegEncoder) ContentType() string { return "audio/mpeg" }
+
+// MountPath reports /stream.mp3.
+func (e *FFmpegEncoder) MountPath() string { return "/stream.mp3" }
+
+// LameEncoder encodes MP3 natively via go-lame instead of spawning
+// ffmpeg, so the compressed bitstream is produced entirely in-process.
+type LameEncoder struct {
+	Bitrate int
+}
+
+// SampleRate reports the PCM input rate this encoder expects.
+func (e *LameEncoder) SampleRate() int { return pcmSampleRate }
+
+// Channels reports the PCM input channel count this encoder expects.
+func (e *LameEncoder) Channels() int { return pcmChannels }
+
+// OpenStream wraps w in a lame.Writer, which already accepts a continuous
+// stream of PCM and emits MP3 frames as it goes.
+func (e *LameEncoder) OpenStream(w io.Writer) (io.WriteCloser, error) {
+	lameWriter, err := lame.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	lameWriter.Encoder.SetInSamplerate(pcmSampleRate)
+	lameWriter.Encoder.SetNumChannels(pcmChannels)
+	lameWriter.Encoder.SetBitrate(e.Bitrate)
+	lameWriter.Encoder.InitParams()
+	return lameWriter, nil
+}
+
+// ContentType reports audio/mpeg.
+func (e *LameEncoder) ContentType() string { return "audio/mpeg" }
+
+// MountPath reports /stream.mp3.
+func (e *LameEncoder) MountPath() string { return "/stream.mp3" }
+
+// OpusEncoder encodes Ogg/Opus natively via gopus instead of spawning
+// ffmpeg.
+type OpusEncoder struct {
+	Bitrate int
+}
+
+const (
+	opusSampleRate = 48000
+	opusFrameSize  = 960 // 20ms at 48kHz
+)
+
+// SampleRate reports the PCM input rate this encoder expects.
+func (e *OpusEncoder) SampleRate() int { return opusSampleRate }
+
+// Channels reports the PCM input channel count this encoder expects.
+func (e *OpusEncoder) Channels() int { return pcmChannels }
+
+// OpenStream returns a pipe that feeds a background goroutine, which
+// packetizes the incoming PCM into opusFrameSize frames, encodes each with
+// gopus, and muxes the resulting Opus packets into Ogg pages written to w,
+// so the stream is a real Ogg/Opus bitstream rather than raw Opus packets.
+func (e *OpusEncoder) OpenStream(w io.Writer) (io.WriteCloser, error) {
+	enc, err := gopus.NewEncoder(opusSampleRate, pcmChannels, gopus.Audio)
+	if err != nil {
+		return nil, err
+	}
+	enc.SetBitrate(e.Bitrate * 1000)
+
+	mux := newOggMuxer(w, rand.Uint32())
+	if err := mux.WriteHeaders(pcmChannels, opusSampleRate); err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer mux.Close()
+
+		frame := make([]int16, opusFrameSize*pcmChannels)
+		buf := make([]byte, len(frame)*2)
+		for {
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return
+			}
+			for i := range frame {
+				frame[i] = int16(buf[2*i]) | int16(buf[2*i+1])<<8
+			}
+
+			data, err := enc.Encode(frame, opusFrameSize, len(buf))
+			if err != nil {
+				fmt.Println("Opus encode error: " + err.Error())
+				return
+			}
+			if err := mux.WritePacket(data, opusFrameSize); err != nil {
+				return
+			}
+		}
+	}()
+
+	return writer, nil
+}
+
+// ContentType reports audio/ogg.
+func (e *OpusEncoder) ContentType() string { return "audio/ogg" }
+
+// MountPath reports /stream.opus.
+func (e *OpusEncoder) MountPath() string { return "/stream.opus" }
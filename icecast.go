@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	initialReconnectBackoff = time.Second
+	maxReconnectBackoff     = 30 * time.Second
+)
+
+// IcecastSource manages a source client connection to an Icecast server:
+// the initial handshake (either the modern PUT or the legacy SOURCE
+// protocol), reconnect-with-backoff on write failure, and "now playing"
+// metadata updates.
+type IcecastSource struct {
+	cfg  *Config
+	addr string
+	conn net.Conn
+}
+
+// NewIcecastSource builds an IcecastSource from cfg. Call Connect before
+// using it as an io.Writer.
+func NewIcecastSource(cfg *Config) *IcecastSource {
+	return &IcecastSource{
+		cfg:  cfg,
+		addr: cfg.IcecastAddress + ":" + strconv.Itoa(cfg.IcecastPort),
+	}
+}
+
+// Connect dials the Icecast server and performs the handshake selected by
+// cfg.IcecastProtocol, returning once the server has accepted the stream.
+func (s *IcecastSource) Connect() error {
+	conn, err := net.Dial("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("could not connect to Icecast: %w", err)
+	}
+
+	if s.cfg.IcecastProtocol == "source" {
+		err = s.handshakeSource(conn)
+	} else {
+		err = s.handshakePut(conn)
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.conn = conn
+	return nil
+}
+
+// handshakePut speaks the modern Icecast2 "PUT /mount HTTP/1.1" protocol.
+func (s *IcecastSource) handshakePut(conn net.Conn) error {
+	credentials := base64.StdEncoding.EncodeToString([]byte(s.cfg.IcecastUser + ":" + s.cfg.IcecastPassword))
+
+	fmt.Fprintf(conn, "PUT %s HTTP/1.1\r\n", s.cfg.IcecastMount)
+	fmt.Fprintf(conn, "Host: %s\r\n", s.addr)
+	fmt.Fprintf(conn, "Authorization: Basic %s\r\n", credentials)
+	fmt.Fprintf(conn, "User-Agent: Yakima/1.0\r\n")
+	fmt.Fprintf(conn, "Accept: */*\r\n")
+	fmt.Fprintf(conn, "Transfer-Encoding: chunked\r\n")
+	s.writeIceHeaders(conn)
+	fmt.Fprintf(conn, "Expect: 100-continue\r\n\r\n")
+
+	status, _, err := readResponse(conn)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(status, "100") {
+		return fmt.Errorf("Icecast server refused PUT handshake: %s", strings.TrimSpace(status))
+	}
+	return nil
+}
+
+// handshakeSource speaks the legacy Shoutcast/Icecast "SOURCE /mount
+// ICE/1.0" protocol, for servers that don't support PUT.
+func (s *IcecastSource) handshakeSource(conn net.Conn) error {
+	credentials := base64.StdEncoding.EncodeToString([]byte(s.cfg.IcecastUser + ":" + s.cfg.IcecastPassword))
+
+	fmt.Fprintf(conn, "SOURCE %s ICE/1.0\r\n", s.cfg.IcecastMount)
+	fmt.Fprintf(conn, "Authorization: Basic %s\r\n", credentials)
+	fmt.Fprintf(conn, "User-Agent: Yakima/1.0\r\n")
+	s.writeIceHeaders(conn)
+	fmt.Fprintf(conn, "\r\n")
+
+	status, _, err := readResponse(conn)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(status, "200") {
+		return fmt.Errorf("Icecast server refused SOURCE handshake: %s", strings.TrimSpace(status))
+	}
+	return nil
+}
+
+// writeIceHeaders writes the Content-Type and Ice-* headers shared by both
+// handshakes, sourced from cfg instead of being hardcoded.
+func (s *IcecastSource) writeIceHeaders(conn net.Conn) {
+	fmt.Fprintf(conn, "Content-Type: %s\r\n", s.cfg.ContentType)
+	fmt.Fprintf(conn, "Ice-Public: 1\r\n")
+	fmt.Fprintf(conn, "Ice-Name: %s\r\n", s.cfg.IceName)
+	fmt.Fprintf(conn, "Ice-Description: %s\r\n", s.cfg.IceDescription)
+	fmt.Fprintf(conn, "Ice-URL: %s\r\n", s.cfg.IceURL)
+	fmt.Fprintf(conn, "Ice-Genre: %s\r\n", s.cfg.IceGenre)
+	fmt.Fprintf(conn, "Ice-Bitrate: %d\r\n", s.cfg.Bitrate)
+}
+
+// readResponse reads a single HTTP-ish status line and its headers off
+// conn using a bufio.Reader, rather than slurping a fixed-size buffer and
+// hoping the whole response fit.
+func readResponse(conn net.Conn) (string, map[string]string, error) {
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		return "", nil, err
+	}
+
+	headers := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return status, headers, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return status, headers, nil
+}
+
+// Write sends p to the Icecast connection. On failure it closes the
+// socket, reconnects with exponential backoff and resends p on the new
+// connection, so the caller can keep streaming rather than exiting.
+func (s *IcecastSource) Write(p []byte) (int, error) {
+	if s.conn == nil {
+		if err := s.reconnectWithBackoff(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.conn.Write(p)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+		fmt.Println("Lost connection to Icecast: " + err.Error())
+		if reconnectErr := s.reconnectWithBackoff(); reconnectErr != nil {
+			return n, reconnectErr
+		}
+		// Reconnected successfully: resend p rather than reporting the
+		// stale write error, so callers that stop on the first error (like
+		// the io.Copy goroutine os/exec drives for an encoder's stdout)
+		// don't treat a recovered hiccup as fatal and stall forever.
+		return s.conn.Write(p)
+	}
+	return n, err
+}
+
+// reconnectWithBackoff retries Connect with exponentially increasing
+// delays, capped at maxReconnectBackoff, until it succeeds.
+func (s *IcecastSource) reconnectWithBackoff() error {
+	backoff := initialReconnectBackoff
+	for {
+		if err := s.Connect(); err == nil {
+			return nil
+		}
+		fmt.Println("Reconnecting to Icecast in " + backoff.String() + "...")
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// Close closes the underlying connection, if one is open.
+func (s *IcecastSource) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// UpdateMetadata pushes title to Icecast's "now playing" admin endpoint so
+// the server's status page reflects the currently streaming track.
+func (s *IcecastSource) UpdateMetadata(title string) error {
+	conn, err := net.Dial("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	credentials := base64.StdEncoding.EncodeToString([]byte(s.cfg.IcecastUser + ":" + s.cfg.IcecastPassword))
+	query := fmt.Sprintf("/admin/metadata?mode=updinfo&mount=%s&song=%s",
+		url.QueryEscape(s.cfg.IcecastMount), url.QueryEscape(title))
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\n", query)
+	fmt.Fprintf(conn, "Host: %s\r\n", s.addr)
+	fmt.Fprintf(conn, "Authorization: Basic %s\r\n", credentials)
+	fmt.Fprintf(conn, "User-Agent: Yakima/1.0\r\n\r\n")
+
+	_, _, err = readResponse(conn)
+	return err
+}
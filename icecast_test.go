@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveHandshakes accepts connections on ln until it's closed, replying to
+// each with a 100-continue response so IcecastSource.Connect succeeds.
+func serveHandshakes(t *testing.T, ln net.Listener) {
+	t.Helper()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || strings.TrimRight(line, "\r\n") == "" {
+						break
+					}
+				}
+				conn.Write([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+			}()
+		}
+	}()
+}
+
+func TestWriteSucceedsAfterReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	serveHandshakes(t, ln)
+
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parsing listener port: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.IcecastAddress = host
+	cfg.IcecastPort = port
+	cfg.IcecastProtocol = "put"
+
+	source := NewIcecastSource(cfg)
+	if err := source.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	if _, err := source.Write([]byte("hello")); err != nil {
+		t.Fatalf("first Write: %v", err)
+	}
+
+	// Force the underlying connection to fail on the next write, as a
+	// dropped Icecast connection would, so Write has to reconnect.
+	source.conn.Close()
+
+	n, err := source.Write([]byte("world"))
+	if err != nil {
+		t.Fatalf("Write after a transient disconnect should succeed once reconnected, got: %v", err)
+	}
+	if n != len("world") {
+		t.Errorf("Write returned n=%d, want %d", n, len("world"))
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Library scans a directory tree for audio files and decodes their
+// metadata, caching the result on disk (keyed by mtime) so that restarts
+// against an unchanged music collection don't have to re-read every file.
+type Library struct {
+	cfg   *Config
+	cache map[string]libraryCacheEntry
+}
+
+type libraryCacheEntry struct {
+	modTime time.Time
+	file    AudioFile
+}
+
+// NewLibrary builds a Library rooted at cfg.PlaybackDirectory.
+func NewLibrary(cfg *Config) *Library {
+	return &Library{cfg: cfg, cache: map[string]libraryCacheEntry{}}
+}
+
+// cachePath is where the scan cache is persisted, alongside the library
+// it describes.
+func (l *Library) cachePath() string {
+	return filepath.Join(l.cfg.PlaybackDirectory, ".yakima-cache")
+}
+
+// Scan walks cfg.PlaybackDirectory recursively, keeps only files matching
+// cfg.Extensions, and returns the resulting audio files. Metadata for
+// files whose mtime matches the on-disk cache is reused as-is; everything
+// else is decoded concurrently by a small worker pool. A directory or file
+// that can't be read (permission errors, broken symlinks, ...) is logged
+// and skipped rather than aborting the whole scan.
+func (l *Library) Scan() ([]AudioFile, error) {
+	l.loadCache()
+
+	var paths []string
+	modTimes := make(map[string]time.Time)
+	err := filepath.WalkDir(l.cfg.PlaybackDirectory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Println("Skipping \"" + path + "\": " + err.Error())
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !l.hasAudioExtension(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		paths = append(paths, path)
+		modTimes[path] = info.ModTime()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := l.decodeAll(paths, modTimes)
+	l.saveCache(files, modTimes)
+	return files, nil
+}
+
+// hasAudioExtension reports whether path's extension is one of
+// cfg.Extensions, case-insensitively.
+func (l *Library) hasAudioExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, allowed := range l.cfg.Extensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeAll reads the metadata for every path in paths, reusing cached
+// entries whose mtime is unchanged and decoding the rest concurrently.
+func (l *Library) decodeAll(paths []string, modTimes map[string]time.Time) []AudioFile {
+	workers := runtime.NumCPU()
+	if workers > 8 {
+		workers = 8
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan string)
+	results := make(chan *AudioFile)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				if cached, ok := l.cache[path]; ok && cached.modTime.Unix() == modTimes[path].Unix() {
+					results <- &cached.file
+					continue
+				}
+				file, success := readAudioFile(path)
+				if !success {
+					results <- nil
+					continue
+				}
+				results <- file
+			}
+		}()
+	}
+
+	go func() {
+		for _, path := range paths {
+			jobs <- path
+		}
+		close(jobs)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var files []AudioFile
+	for file := range results {
+		if file != nil {
+			files = append(files, *file)
+		}
+	}
+	return files
+}
+
+// loadCache reads the on-disk scan cache, if any. Cache corruption or
+// absence just means a full rescan, so errors are swallowed.
+func (l *Library) loadCache() {
+	f, err := os.Open(l.cachePath())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 8 {
+			continue
+		}
+
+		modUnix, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		duration, _ := strconv.Atoi(fields[3])
+		bitrate, _ := strconv.Atoi(fields[4])
+		sampleRate, _ := strconv.Atoi(fields[5])
+
+		l.cache[fields[0]] = libraryCacheEntry{
+			modTime: time.Unix(modUnix, 0),
+			file: AudioFile{
+				filename: fields[2],
+				path:     fields[0],
+				duration: duration,
+				originalQuality: AudioFileQuality{
+					bitrate:     bitrate,
+					sampleRate:  sampleRate,
+					channelMode: fields[6],
+					format:      fields[7],
+				},
+			},
+		}
+	}
+}
+
+// saveCache writes one tab-separated line per file to the scan cache, so
+// the next Scan can skip decoding files whose mtime hasn't changed.
+func (l *Library) saveCache(files []AudioFile, modTimes map[string]time.Time) {
+	f, err := os.Create(l.cachePath())
+	if err != nil {
+		fmt.Println("Could not write library cache: " + err.Error())
+		return
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	defer w.Flush()
+
+	for _, file := range files {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			file.path, modTimes[file.path].Unix(), file.filename, file.duration,
+			file.originalQuality.bitrate, file.originalQuality.sampleRate,
+			file.originalQuality.channelMode, file.originalQuality.format)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHasAudioExtension(t *testing.T) {
+	l := &Library{cfg: &Config{Extensions: []string{".mp3", ".flac"}}}
+
+	if !l.hasAudioExtension("/music/song.MP3") {
+		t.Error("expected .MP3 to match case-insensitively")
+	}
+	if l.hasAudioExtension("/music/cover.jpg") {
+		t.Error("did not expect .jpg to match")
+	}
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLibrary(&Config{PlaybackDirectory: dir})
+
+	modTime := time.Unix(1700000000, 0)
+	file := AudioFile{
+		filename: "song.mp3",
+		path:     filepath.Join(dir, "song.mp3"),
+		duration: 180,
+		originalQuality: AudioFileQuality{
+			bitrate:     320,
+			sampleRate:  44100,
+			channelMode: "stereo",
+			format:      "MP3",
+		},
+	}
+
+	l.saveCache([]AudioFile{file}, map[string]time.Time{file.path: modTime})
+
+	reloaded := NewLibrary(&Config{PlaybackDirectory: dir})
+	reloaded.loadCache()
+
+	cached, ok := reloaded.cache[file.path]
+	if !ok {
+		t.Fatalf("expected %q to be cached after round trip", file.path)
+	}
+	if !cached.modTime.Equal(modTime) {
+		t.Errorf("modTime = %v, want %v", cached.modTime, modTime)
+	}
+	if cached.file != file {
+		t.Errorf("cached file = %+v, want %+v", cached.file, file)
+	}
+}
@@ -3,38 +3,14 @@ package main
 // go-mediainfo requires libmediainfo0v5 libmediainfo-dev packages to be installed (Ubuntu)
 
 import (
-	"encoding/base64"
 	"fmt"
-	"io/ioutil"
-	"net"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/zelenin/go-mediainfo"
 )
 
-const (
-	// PlaybackDirectory is a full or relative path to a directory containing
-	// music to be streamed to an Icecast server
-	// Note the ending separator
-	PlaybackDirectory string = "/home/alis/Music/"
-	// Loop between files / start over when all files were already streamed
-	Loop bool = true
-	// Shuffle files before streaming
-	Shuffle bool = false
-	// IcecastAddress represents an IP address of the Icecast2 server
-	IcecastAddress = "127.0.0.1"
-	// IcecastPort represents a port Icecast2 server listens on
-	IcecastPort = 8999
-	// IcecastUser represents a username of a source to stream with
-	IcecastUser = "source"
-	// IcecastPassword represents a password for the above user
-	IcecastPassword = "1234"
-)
-
 // AudioFileQuality represents an audio format and quality information of a type AudioFile
 type AudioFileQuality struct {
 	bitrate     int
@@ -52,7 +28,6 @@ type AudioFile struct {
 }
 
 var playbackHistory []AudioFile
-var icecastInstance net.Conn
 
 // Splits the string containing path with operating system's path separator and
 // returns the last value from created array
@@ -98,99 +73,47 @@ func readAudioFile(pathToFile string) (*AudioFile, bool) {
 	return &audio, true
 }
 
-// Start a new socket connection, send HTTP headers,
-// wait for 100-Continue HTTP status and return
-func beginIcecastConnection(address string) net.Conn {
-	conn, err := net.Dial("tcp", address)
-	if err != nil {
-		fmt.Println("Couldn't establish connection with Icecast.")
-		fmt.Println(err.Error())
-		os.Exit(2)
-	}
-
-	var authCredentials []byte = []byte(IcecastUser + ":" + IcecastPassword)
-	var credentialsB64 string = base64.StdEncoding.EncodeToString(authCredentials)
-
-	fmt.Fprintf(conn, "PUT /stream.mp3 HTTP/1.1\r\n")
-	fmt.Fprintf(conn, "Host: http://"+address+"\r\n")
-	fmt.Fprintf(conn, "Authorization: Basic "+credentialsB64+"\r\n")
-	fmt.Fprintf(conn, "User-Agent: Yakima/1.0\r\n")
-	fmt.Fprintf(conn, "Accept: */*\r\n")
-	fmt.Fprintf(conn, "Transfer-Encoding: chunked\r\n")
-	fmt.Fprintf(conn, "Content-Type: audio/mpeg\r\n")
-	fmt.Fprintf(conn, "Ice-Public: 1\r\n")
-	fmt.Fprintf(conn, "Ice-Genre: Yakima\r\n")
-	fmt.Fprintf(conn, "Expect: 100-continue\r\n\r\n")
-
-	buff := make([]byte, 1024)
-	conn.Read(buff)
-
-	reply := string(buff)
-	if strings.Contains(reply, "HTTP/1.1 100 Continue") {
-		return conn
-	}
+func main() {
+	cfg := DefaultConfig()
+	ParseFlags(cfg)
 
-	fmt.Println("Icecast server refused data transfer:")
-	fmt.Println(reply)
-	os.Exit(3)
+	encoder := NewEncoder(cfg)
+	ApplyEncoderDefaults(cfg, encoder)
 
-	return conn
-}
-
-func main() {
-	files, err := ioutil.ReadDir(PlaybackDirectory)
+	library := NewLibrary(cfg)
+	queue, err := library.Scan()
 	if err != nil {
-		fmt.Println("Could not read directory \"" + PlaybackDirectory + "\", perhaps I don't have read access?")
+		fmt.Println("Could not scan \"" + cfg.PlaybackDirectory + "\", perhaps I don't have read access?")
 		os.Exit(1)
 	}
 
-	icecastFullAddress := IcecastAddress + ":" + strconv.Itoa(IcecastPort)
-	icecastInstance = beginIcecastConnection(icecastFullAddress)
+	icecastInstance := NewIcecastSource(cfg)
+	if err := icecastInstance.Connect(); err != nil {
+		fmt.Println("Couldn't establish connection with Icecast: " + err.Error())
+		os.Exit(2)
+	}
 	defer icecastInstance.Close()
 
-	var fileIndex int = -1
-	var currentFile os.FileInfo
-	var currentFileBin *os.File
-	for {
-		fileIndex++
-		if fileIndex == len(files) {
-			if Loop {
-				fileIndex = -1
-				continue
-			} else {
-				break
-			}
-		}
-
-		currentFile = files[fileIndex]
-		if currentFile.IsDir() {
-			continue
-		}
+	player := NewPlayer(cfg, encoder, icecastInstance, icecastInstance, queue)
 
-		fileData, success := readAudioFile(PlaybackDirectory + currentFile.Name())
-		if !success {
-			fmt.Println("Error reading " + currentFile.Name())
-			fileData = nil
-			continue
+	if cfg.ControlPort != 0 {
+		if cfg.ControlToken == "" {
+			token, err := generateControlToken()
+			if err != nil {
+				fmt.Println("Could not generate a control API token: " + err.Error())
+				os.Exit(3)
+			}
+			cfg.ControlToken = token
+			fmt.Println("Control API token: " + token + " (send as \"Authorization: Bearer " + token + "\")")
 		}
 
-		fmt.Println("Read " + fileData.filename + " (~" + strconv.Itoa(fileData.duration/60) + " min)")
-		cmd := exec.Command("ffmpeg", "-re", "-i", PlaybackDirectory+currentFile.Name(),
-			"-f", "mp3", "-c:a", "mp3", "-b:a", "128k", "-")
-		wg := sync.WaitGroup{}
-		wg.Add(1)
-		fmt.Println(cmd.String())
-
-		// FFmpeg
+		control := NewControlServer(player, cfg.ControlToken)
 		go func() {
-			defer wg.Done()
-			cmd.Stdout = icecastInstance
-			//cmd.Stderr = os.Stdout
-			cmd.Run()
+			if err := control.ListenAndServe(cfg.ControlPort); err != nil {
+				fmt.Println("Control API stopped: " + err.Error())
+			}
 		}()
-
-		wg.Wait()
-		currentFileBin.Close()
 	}
 
+	player.Run()
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+// pcmBuffer decouples an ffmpeg PCM decode from whatever is consuming its
+// output, so the decoder can run ahead of the mixer instead of the two
+// being locked in step. It behaves like a bounded ring buffer: writes
+// block once capacity bytes are queued, reads block until data is
+// available, and it's internally just a FIFO queue of byte chunks rather
+// than a single circular array.
+type pcmBuffer struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	chunks   [][]byte
+	buffered int
+	capacity int
+	closed   bool
+}
+
+func newPCMBuffer(capacityBytes int) *pcmBuffer {
+	buf := &pcmBuffer{capacity: capacityBytes}
+	buf.cond = sync.NewCond(&buf.mu)
+	return buf
+}
+
+// Write queues p, blocking while the buffer is full. It never partially
+// buffers p: on Close it returns io.ErrClosedPipe instead.
+func (b *pcmBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.buffered >= b.capacity && !b.closed {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	chunk := make([]byte, len(p))
+	copy(chunk, p)
+	b.chunks = append(b.chunks, chunk)
+	b.buffered += len(chunk)
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+// Read drains queued bytes into p, returning io.EOF once the buffer has
+// been closed and fully drained.
+func (b *pcmBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.chunks) == 0 {
+		if b.closed {
+			return 0, io.EOF
+		}
+		b.cond.Wait()
+	}
+
+	chunk := b.chunks[0]
+	n := copy(p, chunk)
+	if n < len(chunk) {
+		b.chunks[0] = chunk[n:]
+	} else {
+		b.chunks = b.chunks[1:]
+	}
+	b.buffered -= n
+	b.cond.Broadcast()
+	return n, nil
+}
+
+// Close marks the buffer closed: pending and future Writes fail, and
+// Read drains whatever remains before returning io.EOF.
+func (b *pcmBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+	return nil
+}
+
+// decodeToPCM runs ffmpeg against path and writes interleaved s16le PCM,
+// resampled to sampleRate/channels, into dest until the file is
+// exhausted or ctx is canceled.
+func decodeToPCM(ctx context.Context, path string, sampleRate, channels int, dest io.Writer) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", path,
+		"-f", "s16le", "-ar", strconv.Itoa(sampleRate), "-ac", strconv.Itoa(channels), "-")
+	cmd.Stdout = dest
+	return cmd.Run()
+}
+
+// mixPCM linearly crossfades two equal-length interleaved s16le PCM
+// buffers into out: fadeOut shrinks toward 0 and fadeIn grows toward 1 as
+// progress goes from 0 to 1. out may alias fadeOut's buffer.
+func mixPCM(fadeOut, fadeIn []byte, out []byte, progress float64) {
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+	outGain := 1 - progress
+	inGain := progress
+
+	samples := len(fadeOut) / 2
+	for i := 0; i < samples; i++ {
+		a := int16(binary.LittleEndian.Uint16(fadeOut[2*i:]))
+		var b int16
+		if 2*i+1 < len(fadeIn) {
+			b = int16(binary.LittleEndian.Uint16(fadeIn[2*i:]))
+		}
+
+		mixed := int32(float64(a)*outGain + float64(b)*inGain)
+		if mixed > 32767 {
+			mixed = 32767
+		} else if mixed < -32768 {
+			mixed = -32768
+		}
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(int16(mixed)))
+	}
+}
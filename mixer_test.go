@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func sampleBytes(v int16) []byte {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, uint16(v))
+	return b
+}
+
+func TestMixPCMEndpoints(t *testing.T) {
+	fadeOut := sampleBytes(10000)
+	fadeIn := sampleBytes(-10000)
+	out := make([]byte, 2)
+
+	mixPCM(fadeOut, fadeIn, out, 0)
+	if got := int16(binary.LittleEndian.Uint16(out)); got != 10000 {
+		t.Errorf("progress 0: got %d, want fadeOut unchanged (10000)", got)
+	}
+
+	mixPCM(fadeOut, fadeIn, out, 1)
+	if got := int16(binary.LittleEndian.Uint16(out)); got != -10000 {
+		t.Errorf("progress 1: got %d, want fadeIn unchanged (-10000)", got)
+	}
+}
+
+func TestMixPCMMaxAmplitudeStaysInRange(t *testing.T) {
+	fadeOut := sampleBytes(32767)
+	fadeIn := sampleBytes(32767)
+	out := make([]byte, 2)
+
+	mixPCM(fadeOut, fadeIn, out, 0.5)
+	got := int16(binary.LittleEndian.Uint16(out))
+	if got != 32767 {
+		t.Errorf("mixing two max-amplitude samples should stay at 32767, got %d", got)
+	}
+}
+
+func TestPCMBufferReadWrite(t *testing.T) {
+	buf := newPCMBuffer(1024)
+	if _, err := buf.Write([]byte{1, 2, 3, 4}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	buf.Close()
+
+	out := make([]byte, 4)
+	n, err := buf.Read(out)
+	if err != nil || n != 4 {
+		t.Fatalf("Read = (%d, %v), want (4, nil)", n, err)
+	}
+
+	if _, err := buf.Read(make([]byte, 1)); err == nil {
+		t.Error("expected EOF once the closed buffer is drained")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// oggCRCTable is the CRC-32 table Ogg page checksums are computed with:
+// polynomial 0x04c11db7, non-reflected, zero initial value - not the same
+// table as the usual IEEE crc32 used elsewhere in Go.
+var oggCRCTable [256]uint32
+
+func init() {
+	for i := range oggCRCTable {
+		crc := uint32(i) << 24
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x80000000 != 0 {
+				crc = (crc << 1) ^ 0x04c11db7
+			} else {
+				crc = crc << 1
+			}
+		}
+		oggCRCTable[i] = crc
+	}
+}
+
+func oggCRC32(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = (crc << 8) ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+const (
+	oggHeaderContinued = 0x01
+	oggHeaderBOS       = 0x02
+	oggHeaderEOS       = 0x04
+)
+
+// oggMuxer packages Opus packets into Ogg pages and writes them to w, per
+// RFC 7845. It's a minimal, write-only muxer: one continuous logical
+// stream, no multiplexing of several streams into one page sequence.
+type oggMuxer struct {
+	w       io.Writer
+	serial  uint32
+	seq     uint32
+	granule uint64
+
+	pending        [][]byte
+	pendingSegs    int
+	pendingBOSdone bool
+}
+
+// newOggMuxer creates a muxer for one logical Ogg stream identified by serial.
+func newOggMuxer(w io.Writer, serial uint32) *oggMuxer {
+	return &oggMuxer{w: w, serial: serial}
+}
+
+// opusHeadPacket builds the mandatory first packet of an Ogg/Opus stream.
+func opusHeadPacket(channels int, sampleRate int) []byte {
+	head := make([]byte, 19)
+	copy(head[0:8], "OpusHead")
+	head[8] = 1 // version
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint16(head[10:12], 0)                  // pre-skip
+	binary.LittleEndian.PutUint32(head[12:16], uint32(sampleRate)) // original input rate, informational only
+	binary.LittleEndian.PutUint16(head[16:18], 0)                  // output gain
+	head[18] = 0                                                   // channel mapping family
+	return head
+}
+
+// opusTagsPacket builds the mandatory second packet of an Ogg/Opus stream.
+func opusTagsPacket() []byte {
+	vendor := "yakima"
+	tags := make([]byte, 0, 8+4+len(vendor)+4)
+	tags = append(tags, "OpusTags"...)
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(vendor)))
+	tags = append(tags, lenBuf[:]...)
+	tags = append(tags, vendor...)
+	binary.LittleEndian.PutUint32(lenBuf[:], 0) // no user comments
+	tags = append(tags, lenBuf[:]...)
+	return tags
+}
+
+// WriteHeaders emits the OpusHead and OpusTags pages that must open every
+// Ogg/Opus stream, each as its own page so players can identify the
+// stream before any audio data arrives.
+func (m *oggMuxer) WriteHeaders(channels, sampleRate int) error {
+	if err := m.writePage([][]byte{opusHeadPacket(channels, sampleRate)}, oggHeaderBOS, 0); err != nil {
+		return err
+	}
+	return m.writePage([][]byte{opusTagsPacket()}, 0, 0)
+}
+
+// maxSegmentsPerPage is libogg's own limit: the segment table is a single
+// byte count, so a page can carry at most 255 lacing values.
+const maxSegmentsPerPage = 255
+
+// WritePacket queues an encoded Opus packet covering frameSize samples
+// (at the encoder's sample rate), flushing the page built so far first if
+// this packet wouldn't fit in it - a page's segment table is a single
+// byte count, so it can never carry more than maxSegmentsPerPage lacing
+// values no matter how large the next packet is.
+func (m *oggMuxer) WritePacket(packet []byte, frameSize int) error {
+	segs := segmentsFor(len(packet))
+	if m.pendingSegs+segs > maxSegmentsPerPage {
+		if err := m.flush(0); err != nil {
+			return err
+		}
+	}
+
+	m.granule += uint64(frameSize)
+	m.pending = append(m.pending, packet)
+	m.pendingSegs += segs
+	return nil
+}
+
+// Close flushes any buffered packets as a final, end-of-stream page.
+func (m *oggMuxer) Close() error {
+	if len(m.pending) == 0 {
+		return nil
+	}
+	return m.flush(oggHeaderEOS)
+}
+
+func (m *oggMuxer) flush(extraFlags byte) error {
+	packets := m.pending
+	m.pending = nil
+	m.pendingSegs = 0
+	return m.writePage(packets, extraFlags, m.granule)
+}
+
+// segmentsFor reports how many 255-byte lacing values a packet of length n
+// needs, including the trailing sub-255 (or zero) segment that marks
+// where the packet ends.
+func segmentsFor(n int) int {
+	segs := n/255 + 1
+	return segs
+}
+
+// writePage lays out packets as a single Ogg page: a segment table built
+// from each packet's lacing values, followed by the concatenated packet
+// payloads, with the page header's checksum computed over the whole page.
+func (m *oggMuxer) writePage(packets [][]byte, headerType byte, granule uint64) error {
+	var segmentTable []byte
+	var payload []byte
+	for _, packet := range packets {
+		remaining := len(packet)
+		for remaining >= 255 {
+			segmentTable = append(segmentTable, 255)
+			remaining -= 255
+		}
+		segmentTable = append(segmentTable, byte(remaining))
+		payload = append(payload, packet...)
+	}
+
+	header := make([]byte, 27+len(segmentTable))
+	copy(header[0:4], "OggS")
+	header[4] = 0 // version
+	header[5] = headerType
+	binary.LittleEndian.PutUint64(header[6:14], granule)
+	binary.LittleEndian.PutUint32(header[14:18], m.serial)
+	binary.LittleEndian.PutUint32(header[18:22], m.seq)
+	// header[22:26] checksum, filled in below
+	header[26] = byte(len(segmentTable))
+	copy(header[27:], segmentTable)
+	m.seq++
+
+	page := append(header, payload...)
+	checksum := oggCRC32(page)
+	binary.LittleEndian.PutUint32(page[22:26], checksum)
+
+	_, err := m.w.Write(page)
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestOggMuxerWritesValidPageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	mux := newOggMuxer(&buf, 0x1234)
+
+	if err := mux.WriteHeaders(2, opusSampleRate); err != nil {
+		t.Fatalf("WriteHeaders: %v", err)
+	}
+	if err := mux.WritePacket([]byte{1, 2, 3}, opusFrameSize); err != nil {
+		t.Fatalf("WritePacket: %v", err)
+	}
+	if err := mux.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data := buf.Bytes()
+	pages := 0
+	for len(data) > 0 {
+		if string(data[0:4]) != "OggS" {
+			t.Fatalf("expected OggS capture pattern, got %q", data[0:4])
+		}
+		segCount := int(data[26])
+		headerLen := 27 + segCount
+		payloadLen := 0
+		for _, seg := range data[27:headerLen] {
+			payloadLen += int(seg)
+		}
+
+		page := data[:headerLen+payloadLen]
+		gotCRC := binary.LittleEndian.Uint32(page[22:26])
+		check := make([]byte, len(page))
+		copy(check, page)
+		binary.LittleEndian.PutUint32(check[22:26], 0)
+		if wantCRC := oggCRC32(check); gotCRC != wantCRC {
+			t.Errorf("page %d: checksum = %x, want %x", pages, gotCRC, wantCRC)
+		}
+
+		data = data[len(page):]
+		pages++
+	}
+
+	if pages != 3 {
+		t.Fatalf("expected OpusHead, OpusTags and one data page, got %d pages", pages)
+	}
+}
+
+func TestOggMuxerNeverOverflowsPageSegmentTable(t *testing.T) {
+	var buf bytes.Buffer
+	mux := newOggMuxer(&buf, 0x1234)
+
+	if err := mux.WriteHeaders(2, opusSampleRate); err != nil {
+		t.Fatalf("WriteHeaders: %v", err)
+	}
+
+	// Max-size Opus packets (1275 bytes) need 6 lacing segments each; at
+	// 50 of them the running total would overflow a single page's
+	// 255-segment limit if WritePacket only checked after appending.
+	const packetLen = 1275
+	const packetCount = 50
+	var totalPayload int
+	for i := 0; i < packetCount; i++ {
+		packet := bytes.Repeat([]byte{byte(i)}, packetLen)
+		if err := mux.WritePacket(packet, opusFrameSize); err != nil {
+			t.Fatalf("WritePacket %d: %v", i, err)
+		}
+		totalPayload += packetLen
+	}
+	if err := mux.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data := buf.Bytes()
+	var reconstructedPayload int
+	for len(data) > 0 {
+		if string(data[0:4]) != "OggS" {
+			t.Fatalf("expected OggS capture pattern, got %q", data[0:4])
+		}
+		segCount := int(data[26])
+		if segCount > maxSegmentsPerPage {
+			t.Fatalf("page segment count %d exceeds the 255 a single byte can hold", segCount)
+		}
+
+		headerLen := 27 + segCount
+		payloadLen := 0
+		for _, seg := range data[27:headerLen] {
+			payloadLen += int(seg)
+		}
+		reconstructedPayload += payloadLen
+		data = data[headerLen+payloadLen:]
+	}
+
+	// The OpusHead and OpusTags header packets also contribute payload
+	// bytes, so just check all the audio payload made it through intact
+	// rather than re-deriving their exact sizes here.
+	if reconstructedPayload < totalPayload {
+		t.Errorf("reconstructed payload %d bytes, want at least %d (packets lost or truncated)", reconstructedPayload, totalPayload)
+	}
+}
+
+func TestSegmentsForMultipleOf255(t *testing.T) {
+	if got := segmentsFor(255); got != 2 {
+		t.Errorf("segmentsFor(255) = %d, want 2 (255-byte segment plus terminating 0)", got)
+	}
+	if got := segmentsFor(10); got != 1 {
+		t.Errorf("segmentsFor(10) = %d, want 1", got)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetadataUpdater is the subset of IcecastSource that Player needs to
+// announce "now playing" information, kept separate so Player doesn't
+// depend on the Icecast protocol directly.
+type MetadataUpdater interface {
+	UpdateMetadata(title string) error
+}
+
+// historyLimit is how many of the most recently played tracks Player
+// avoids repeating when shuffling, via the shared playbackHistory.
+const historyLimit = 5
+
+// pcmBufferSeconds sizes each track's decode buffer in seconds of audio,
+// giving the decoder enough headroom to run ahead of the mixer.
+const pcmBufferSeconds = 5
+
+// trackStream is one track's in-flight decode: PCM flows from the ffmpeg
+// process into pcm as it's produced, and cancel lets Skip or a track
+// change stop the decode early.
+type trackStream struct {
+	file   AudioFile
+	pcm    *pcmBuffer
+	cancel context.CancelFunc
+}
+
+// Player owns the play queue and drives the streaming loop. A single
+// persistent StreamEncoder owns the Icecast connection for the whole run;
+// Player decodes each track to PCM and crosses its tail into the head of
+// the next track before handing the mixed PCM to that encoder, so the
+// compressed bitstream on the wire never resets between tracks. It also
+// exposes control operations (Skip, Enqueue, Shuffle, NowPlaying, Queue)
+// that other goroutines - like the control HTTP API - can call safely
+// while Run is in progress.
+type Player struct {
+	cfg      *Config
+	encoder  StreamEncoder
+	dest     io.Writer
+	metadata MetadataUpdater
+
+	mu        sync.Mutex
+	queue     []AudioFile
+	order     []int // playback order, as indices into queue
+	fileIndex int   // index into order
+	current   *trackStream
+	startedAt time.Time
+}
+
+// NewPlayer builds a Player over the given queue. Call Run to start
+// streaming; it blocks, so callers typically run it in its own goroutine.
+// metadata may be nil to skip "now playing" announcements.
+func NewPlayer(cfg *Config, encoder StreamEncoder, dest io.Writer, metadata MetadataUpdater, queue []AudioFile) *Player {
+	return &Player{
+		cfg:       cfg,
+		encoder:   encoder,
+		dest:      dest,
+		metadata:  metadata,
+		queue:     queue,
+		fileIndex: -1,
+	}
+}
+
+// Run opens the persistent encoder stream and plays the queue into it,
+// track by track, crossfading the tail of each track into the head of the
+// next. It returns once the queue is exhausted and cfg.Loop is false, or
+// once there is nothing left to play.
+func (p *Player) Run() {
+	streamWriter, err := p.encoder.OpenStream(p.dest)
+	if err != nil {
+		fmt.Println("Could not start encoder stream: " + err.Error())
+		return
+	}
+	defer streamWriter.Close()
+
+	sampleRate, channels := p.encoder.SampleRate(), p.encoder.Channels()
+
+	file, ok := p.advance()
+	if !ok {
+		return
+	}
+	current := p.beginTrack(file, sampleRate, channels)
+
+	for {
+		nextFile, hasNext := p.peek()
+		var next *trackStream
+		if hasNext {
+			next = p.startDecode(nextFile, sampleRate, channels)
+		}
+
+		p.mix(streamWriter, current, next, sampleRate, channels)
+
+		if next == nil {
+			break
+		}
+		p.advance()
+		current = p.adopt(next)
+	}
+}
+
+// beginTrack starts decoding file and makes it the current track,
+// recording the start time and announcing it over metadata.
+func (p *Player) beginTrack(file AudioFile, sampleRate, channels int) *trackStream {
+	ts := p.startDecode(file, sampleRate, channels)
+	return p.adopt(ts)
+}
+
+// adopt installs ts as the current track: it updates bookkeeping used by
+// NowPlaying/Skip and sends the "now playing" metadata update.
+func (p *Player) adopt(ts *trackStream) *trackStream {
+	p.mu.Lock()
+	p.current = ts
+	p.startedAt = time.Now()
+	p.mu.Unlock()
+
+	fmt.Println("Now playing: " + ts.file.filename)
+	if p.metadata != nil {
+		if err := p.metadata.UpdateMetadata(ts.file.filename); err != nil {
+			fmt.Println("Could not update Icecast metadata: " + err.Error())
+		}
+	}
+	return ts
+}
+
+// startDecode spawns a goroutine that decodes file to PCM into a fresh
+// buffer, returning a trackStream the mixer can read from immediately
+// while the decode continues in the background.
+func (p *Player) startDecode(file AudioFile, sampleRate, channels int) *trackStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	buf := newPCMBuffer(sampleRate * channels * 2 * pcmBufferSeconds)
+
+	go func() {
+		if err := decodeToPCM(ctx, file.path, sampleRate, channels, buf); err != nil && ctx.Err() == nil {
+			fmt.Println("Decoder error for " + file.filename + ": " + err.Error())
+		}
+		buf.Close()
+	}()
+
+	return &trackStream{file: file, pcm: buf, cancel: cancel}
+}
+
+// mix reads current's PCM and writes it to w, crossfading into next's PCM
+// during the last cfg.CrossfadeSeconds of current once next is decoding.
+// It returns once current is exhausted (end of file, or Skip canceled it).
+func (p *Player) mix(w io.Writer, current, next *trackStream, sampleRate, channels int) {
+	frameBytes := channels * 2
+	chunkBytes := (p.cfg.ChunkSize / frameBytes) * frameBytes
+	if chunkBytes < frameBytes {
+		chunkBytes = frameBytes
+	}
+	framesPerChunk := chunkBytes / frameBytes
+
+	// A duration of 0 means readAudioFile couldn't determine it (mediainfo
+	// left it blank/unparseable); fadeStart would otherwise clamp to 0 and
+	// crossfade the next track in over the whole song instead of just its
+	// tail, so skip crossfading entirely rather than guess.
+	crossfade := current.file.duration > 0
+
+	fadeChunks := (p.cfg.CrossfadeSeconds * sampleRate) / framesPerChunk
+	if fadeChunks < 1 {
+		fadeChunks = 1
+	}
+	totalChunks := (current.file.duration * sampleRate) / framesPerChunk
+	fadeStart := totalChunks - fadeChunks
+	if fadeStart < 0 {
+		fadeStart = 0
+	}
+
+	curChunk := make([]byte, chunkBytes)
+	nextChunk := make([]byte, chunkBytes)
+	mixed := make([]byte, chunkBytes)
+
+	for chunkIndex := 0; ; chunkIndex++ {
+		n, err := io.ReadFull(current.pcm, curChunk)
+		if n == 0 {
+			return
+		}
+
+		var writeErr error
+		if next != nil && crossfade && chunkIndex >= fadeStart {
+			nn, _ := io.ReadFull(next.pcm, nextChunk)
+			progress := float64(chunkIndex-fadeStart) / float64(fadeChunks)
+			mixPCM(curChunk[:n], nextChunk[:nn], mixed[:n], progress)
+			_, writeErr = w.Write(mixed[:n])
+		} else {
+			_, writeErr = w.Write(curChunk[:n])
+		}
+		if writeErr != nil {
+			fmt.Println("Stream write error: " + writeErr.Error())
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// peek returns the track that advance would hand out next, without
+// moving fileIndex or recording it in playbackHistory. At the end of a
+// lap it rebuilds the next lap's order first (see reorder), so the track
+// it returns is the one advance hands out once it wraps around.
+func (p *Player) peek() (AudioFile, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.queue) == 0 || len(p.order) != len(p.queue) {
+		return AudioFile{}, false
+	}
+
+	next := p.fileIndex + 1
+	if next >= len(p.order) {
+		if !p.cfg.Loop {
+			return AudioFile{}, false
+		}
+		next = 0
+		p.reorder()
+	}
+	return p.queue[p.order[next]], true
+}
+
+// advance locks the queue, moves fileIndex to the next track and returns
+// it, honoring cfg.Loop once the end of the queue is reached. The second
+// return value is false once playback should stop entirely.
+func (p *Player) advance() (AudioFile, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.queue) == 0 {
+		return AudioFile{}, false
+	}
+
+	if len(p.order) != len(p.queue) {
+		p.reorder()
+	}
+
+	p.fileIndex++
+	if p.fileIndex >= len(p.order) {
+		if !p.cfg.Loop {
+			return AudioFile{}, false
+		}
+		// peek already rebuilt the order for this lap when it looked
+		// past the end, and Run is decoding the track it returned.
+		p.fileIndex = 0
+	}
+
+	file := p.queue[p.order[p.fileIndex]]
+	p.recordHistory(file)
+	return file, true
+}
+
+// reorder rebuilds p.order as either a straight 0..n-1 sequence, or - when
+// cfg.Shuffle is set - a fresh Fisher-Yates shuffle of it. When shuffling,
+// it also swaps a track played within the last historyLimit tracks out of
+// the first slot, if a better candidate exists, so consecutive laps don't
+// immediately repeat the tail of the previous one.
+func (p *Player) reorder() {
+	p.order = make([]int, len(p.queue))
+	for i := range p.order {
+		p.order[i] = i
+	}
+	if !p.cfg.Shuffle {
+		return
+	}
+
+	rand.Shuffle(len(p.order), func(i, j int) {
+		p.order[i], p.order[j] = p.order[j], p.order[i]
+	})
+
+	for i, idx := range p.order {
+		if !p.inRecentHistory(p.queue[idx]) {
+			p.order[0], p.order[i] = p.order[i], p.order[0]
+			break
+		}
+	}
+}
+
+// inRecentHistory reports whether file was among the last historyLimit
+// tracks recorded in playbackHistory.
+func (p *Player) inRecentHistory(file AudioFile) bool {
+	start := len(playbackHistory) - historyLimit
+	if start < 0 {
+		start = 0
+	}
+	for _, past := range playbackHistory[start:] {
+		if past.path == file.path {
+			return true
+		}
+	}
+	return false
+}
+
+// recordHistory appends file to the shared playbackHistory, trimming it
+// so it doesn't grow without bound over a long-running stream.
+func (p *Player) recordHistory(file AudioFile) {
+	playbackHistory = append(playbackHistory, file)
+	if kept := historyLimit * 4; len(playbackHistory) > kept {
+		playbackHistory = playbackHistory[len(playbackHistory)-kept:]
+	}
+}
+
+// Skip cancels the currently playing track's decode, so mix moves on to
+// the next track as soon as the PCM already in its buffer has drained,
+// instead of waiting for the whole track to finish.
+func (p *Player) Skip() {
+	p.mu.Lock()
+	current := p.current
+	p.mu.Unlock()
+
+	if current != nil {
+		current.cancel()
+	}
+}
+
+// Enqueue reads the audio file at path and appends it to the play queue,
+// right after the tracks already lined up to play. path must resolve to
+// somewhere under cfg.PlaybackDirectory, so a caller (e.g. the control
+// API) can't use it to make Yakima open arbitrary files on disk.
+func (p *Player) Enqueue(path string) error {
+	if err := p.requireWithinLibrary(path); err != nil {
+		return err
+	}
+
+	file, success := readAudioFile(path)
+	if !success {
+		return fmt.Errorf("could not read audio file %q", path)
+	}
+
+	p.mu.Lock()
+	idx := len(p.queue)
+	p.queue = append(p.queue, *file)
+	if p.order != nil {
+		p.order = append(p.order, idx)
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// requireWithinLibrary rejects any path that resolves outside
+// cfg.PlaybackDirectory, including via "..", symlinks aside, so Enqueue
+// can't be used to read files elsewhere on disk.
+func (p *Player) requireWithinLibrary(path string) error {
+	root, err := filepath.Abs(p.cfg.PlaybackDirectory)
+	if err != nil {
+		return err
+	}
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path %q is outside the playback directory", path)
+	}
+	return nil
+}
+
+// Shuffle randomizes the order of the tracks still ahead of the one
+// currently playing. The slot right after the current track is left
+// alone: Run has already peeked it and started decoding it as the
+// lookahead track for crossfading, so reshuffling it out from under Run
+// would desync fileIndex/playbackHistory from what's actually streaming.
+func (p *Player) Shuffle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fileIndex+2 >= len(p.order) {
+		return
+	}
+
+	remaining := p.order[p.fileIndex+2:]
+	rand.Shuffle(len(remaining), func(i, j int) {
+		remaining[i], remaining[j] = remaining[j], remaining[i]
+	})
+}
+
+// NowPlaying returns the currently playing track and how many seconds of
+// it have elapsed, or ok=false if nothing is playing yet.
+func (p *Player) NowPlaying() (file AudioFile, elapsed int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current == nil {
+		return AudioFile{}, 0, false
+	}
+	return p.current.file, int(time.Since(p.startedAt).Seconds()), true
+}
+
+// Queue returns the tracks still ahead of the one currently playing, in
+// playback order.
+func (p *Player) Queue() []AudioFile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fileIndex+1 >= len(p.order) {
+		return nil
+	}
+
+	upcoming := make([]AudioFile, len(p.order)-p.fileIndex-1)
+	for i, idx := range p.order[p.fileIndex+1:] {
+		upcoming[i] = p.queue[idx]
+	}
+	return upcoming
+}
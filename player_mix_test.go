@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func fillBuffer(data []byte) *pcmBuffer {
+	buf := newPCMBuffer(len(data) + 1)
+	buf.Write(data)
+	buf.Close()
+	return buf
+}
+
+func TestMixSkipsCrossfadeWhenDurationUnknown(t *testing.T) {
+	p := &Player{cfg: &Config{ChunkSize: 4, CrossfadeSeconds: 5}}
+
+	sampleRate, channels := 8, 1 // tiny values so the test data is a handful of bytes
+	currentData := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	nextData := []byte{9, 9, 9, 9, 9, 9, 9, 9}
+
+	current := &trackStream{
+		file: AudioFile{duration: 0}, // unknown duration
+		pcm:  fillBuffer(currentData),
+	}
+	next := &trackStream{
+		file: AudioFile{duration: 10},
+		pcm:  fillBuffer(nextData),
+	}
+
+	var out bytes.Buffer
+	p.mix(&out, current, next, sampleRate, channels)
+
+	if !bytes.Equal(out.Bytes(), currentData) {
+		t.Errorf("mix with unknown duration produced %v, want current track unmixed: %v", out.Bytes(), currentData)
+	}
+}
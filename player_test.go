@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestPlayer(n int) *Player {
+	queue := make([]AudioFile, n)
+	for i := range queue {
+		queue[i] = AudioFile{filename: string(rune('a' + i)), path: string(rune('a' + i))}
+	}
+	return &Player{
+		cfg:       &Config{},
+		queue:     queue,
+		order:     []int{0, 1, 2, 3, 4},
+		fileIndex: -1,
+	}
+}
+
+func TestReorderIsPermutation(t *testing.T) {
+	p := newTestPlayer(5)
+	p.cfg.Shuffle = true
+	p.reorder()
+
+	seen := make(map[int]bool)
+	for _, idx := range p.order {
+		if idx < 0 || idx >= len(p.queue) || seen[idx] {
+			t.Fatalf("reorder produced an invalid permutation: %v", p.order)
+		}
+		seen[idx] = true
+	}
+}
+
+func TestRecordHistoryTrims(t *testing.T) {
+	p := newTestPlayer(1)
+	playbackHistory = nil
+	for i := 0; i < historyLimit*4+3; i++ {
+		p.recordHistory(p.queue[0])
+	}
+	if len(playbackHistory) != historyLimit*4 {
+		t.Fatalf("expected playbackHistory trimmed to %d entries, got %d", historyLimit*4, len(playbackHistory))
+	}
+}
+
+func TestShuffleLeavesLookaheadSlotUntouched(t *testing.T) {
+	p := newTestPlayer(5)
+	p.fileIndex = 0 // order[1] is the lookahead slot Run already peeked/decoding
+
+	lookahead := p.order[p.fileIndex+1]
+	p.Shuffle()
+
+	if p.order[p.fileIndex+1] != lookahead {
+		t.Fatalf("Shuffle moved the in-flight lookahead slot: wanted %d, got %d", lookahead, p.order[p.fileIndex+1])
+	}
+}
+
+func TestRequireWithinLibrary(t *testing.T) {
+	dir := t.TempDir()
+	p := &Player{cfg: &Config{PlaybackDirectory: dir}}
+
+	if err := p.requireWithinLibrary(filepath.Join(dir, "song.mp3")); err != nil {
+		t.Errorf("expected a path inside the library to be allowed, got: %v", err)
+	}
+	if err := p.requireWithinLibrary(filepath.Join(dir, "..", "outside.mp3")); err == nil {
+		t.Error("expected a path escaping the library via .. to be rejected")
+	}
+	if err := p.requireWithinLibrary("/etc/passwd"); err == nil {
+		t.Error("expected an absolute path outside the library to be rejected")
+	}
+}